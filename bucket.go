@@ -7,201 +7,269 @@ import (
 	"time"
 )
 
+// MaceBucket is a named cache. Its keyspace is split across a fixed
+// number of shards (see shard.go) so that two keys hashing to different
+// shards never contend on the same lock; only the handful of bucket-wide
+// settings below (callbacks, the data loader, capacity policy) share a
+// single small mutex, since they change far less often than the cache
+// itself.
 type MaceBucket struct {
-	sync.RWMutex
-	name         string
-	items        map[string]*MaceItem
-	leakqueue    *leakQueue
-	leakTimer    *time.Timer
-	leakInterval time.Duration
+	name   string
+	dsn    string
+	shards []*shard
+
+	cfgMu        sync.RWMutex
 	logger       *log.Logger
 	loadItems    func(string) *MaceItem
 	onAddItem    func(*MaceItem)
-	onDeleteItem func(*MaceItem)
+	onDeleteItem func(*MaceItem, EvictionReason)
+
+	capacity         int
+	maxBytes         int64
+	policy           EvictionPolicy
+	costFunc         CostFunc
+	negativeCacheTTL time.Duration
+
+	// scavengerStop, if non-nil, shuts down this bucket's periodic
+	// scavenger goroutine; see SetScavenger in scavenger.go.
+	scavengerStop chan struct{}
+}
+
+// config is a consistent snapshot of the bucket-wide settings taken under
+// cfgMu.RLock(), so a shard operation doesn't have to reacquire cfgMu for
+// every field it needs.
+type config struct {
+	logger           *log.Logger
+	loadItems        func(string) *MaceItem
+	onAddItem        func(*MaceItem)
+	onDeleteItem     func(*MaceItem, EvictionReason)
+	capacity         int
+	maxBytes         int64
+	policy           EvictionPolicy
+	costFunc         CostFunc
+	negativeCacheTTL time.Duration
+}
+
+func (bucket *MaceBucket) snapshotConfig() config {
+	bucket.cfgMu.RLock()
+	defer bucket.cfgMu.RUnlock()
+	return config{
+		logger:           bucket.logger,
+		loadItems:        bucket.loadItems,
+		onAddItem:        bucket.onAddItem,
+		onDeleteItem:     bucket.onDeleteItem,
+		capacity:         bucket.capacity,
+		maxBytes:         bucket.maxBytes,
+		policy:           bucket.policy,
+		costFunc:         bucket.costFunc,
+		negativeCacheTTL: bucket.negativeCacheTTL,
+	}
 }
 
 func (bucket *MaceBucket) Count() int {
-	bucket.RLock()
-	defer bucket.RUnlock()
-	return len(bucket.items)
+	total := 0
+	for _, s := range bucket.shards {
+		s.RLock()
+		total += s.store.Len()
+		s.RUnlock()
+	}
+	return total
 }
 
 func (bucket *MaceBucket) SetDataLoader(f func(string) *MaceItem) {
-	bucket.Lock()
-	defer bucket.Unlock()
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
 	bucket.loadItems = f
 }
 
 func (bucket *MaceBucket) SetOnAddItem(f func(*MaceItem)) {
-	bucket.Lock()
-	defer bucket.Unlock()
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
 	bucket.onAddItem = f
 }
 
-func (bucket *MaceBucket) SetOnDeleteItem(f func(*MaceItem)) {
-	bucket.Lock()
-	defer bucket.Unlock()
+func (bucket *MaceBucket) SetOnDeleteItem(f func(*MaceItem, EvictionReason)) {
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
 	bucket.onDeleteItem = f
 }
 
 func (bucket *MaceBucket) SetLogger(logger *log.Logger) {
-	bucket.Lock()
-	defer bucket.Unlock()
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
 	bucket.logger = logger
 }
 
-func (bucket *MaceBucket) leakCheck() {
-	bucket.Lock()
-	if bucket.leakTimer != nil {
-		bucket.leakTimer.Stop()
+func (bucket *MaceBucket) log(v ...interface{}) {
+	bucket.cfgMu.RLock()
+	logger := bucket.logger
+	bucket.cfgMu.RUnlock()
+	if logger == nil {
+		return
 	}
-	if bucket.leakInterval > 0 {
-		bucket.log("Expiration check triggered after " + bucket.leakInterval.String() + " for bucket" + bucket.name)
+	logger.Println(v...)
+}
+
+// usesLeakQueue reports whether a shard's own TTL/leak-queue machinery
+// applies. It does for the in-memory store; remote stores (Redis,
+// Memcached, ...) expire items on the backend side instead.
+func (s *shard) usesLeakQueue() bool {
+	_, ok := s.store.(*memStore)
+	return ok
+}
+
+// leakCheck drains every item that's already past its dispose time in a
+// single locked pass (using Peek to stop as soon as the queue's earliest
+// item is still alive, rather than popping-and-pushing-back one item per
+// call), then, unless the bucket is in scavenger mode (see
+// SetScavenger), arms a timer for the next expiry.
+func (bucket *MaceBucket) leakCheck(s *shard) {
+	if !s.usesLeakQueue() {
+		return
+	}
+	s.Lock()
+	if s.leakTimer != nil {
+		s.leakTimer.Stop()
+	}
+	if s.leakInterval > 0 {
+		bucket.log("Expiration check triggered after " + s.leakInterval.String() + " for bucket" + bucket.name)
 	} else {
 		bucket.log("Expiration check installed on bucket", bucket.name)
 	}
 	invalidL := []*disposeItem{}
 	cur := time.Now()
-	l := bucket.leakqueue
 	for {
-		if l.Len() > 0 {
-			if it := heap.Pop(l); cur.Sub(it.(*disposeItem).disposeTime) >= 0 {
-				invalidL = append(invalidL, it.(*disposeItem))
-			} else {
-				heap.Push(l, (it.(*disposeItem)))
-				break
-			}
+		it := s.leakqueue.Peek()
+		if it == nil || cur.Sub(it.disposeTime) < 0 {
 			break
-
 		}
+		invalidL = append(invalidL, heap.Pop(s.leakqueue).(*disposeItem))
 	}
-	bucket.Unlock()
-
-	// fetch current time for comparison
-	// used to create next timer callback
+	s.Unlock()
 
-	// Change this to Heap so that cleaning is after
-	// at expense of more space usage
-	// Per item timestamp + pointer to item
 	for _, itemP := range invalidL {
 		key := itemP.value
-		bucket.Delete(key)
+		bucket.delete(s, key, EvictionReasonExpired)
 	}
-	bucket.Lock()
-	if bucket.leakqueue.Len() > 0 {
-		itemMin := heap.Pop(bucket.leakqueue).(*disposeItem)
+
+	s.Lock()
+	if !s.scavenging && s.leakqueue.Len() > 0 {
+		itemMin := heap.Pop(s.leakqueue).(*disposeItem)
 		dur := itemMin.disposeTime
-		bucket.leakInterval = dur.Sub(cur)
-		bucket.leakTimer = time.AfterFunc(bucket.leakInterval, func() {
-			go bucket.leakCheck()
+		s.leakInterval = dur.Sub(cur)
+		s.leakTimer = time.AfterFunc(s.leakInterval, func() {
+			go bucket.leakCheck(s)
 		})
-		heap.Push(bucket.leakqueue, itemMin)
+		heap.Push(s.leakqueue, itemMin)
 	}
-	bucket.Unlock()
-
+	s.Unlock()
 }
 
 func (bucket *MaceBucket) Delete(key string) (*MaceItem, error) {
-	bucket.Lock()
+	return bucket.delete(bucket.shardFor(key), key, EvictionReasonManual)
+}
 
-	v, ok := bucket.items[key]
+func (bucket *MaceBucket) delete(s *shard, key string, reason EvictionReason) (*MaceItem, error) {
+	s.Lock()
+
+	v, ok := s.store.Get(key)
 	if !ok {
-		bucket.Unlock()
+		s.Unlock()
 		return nil, ErrKeyNotFound
 	}
-	deleteCallback := bucket.onDeleteItem
-	bucket.Unlock()
-	if deleteCallback != nil {
+	cfg := bucket.snapshotConfig()
+	s.Unlock()
+	if cfg.onDeleteItem != nil {
 		// TODO: clone item before calling this routine
 		// Secondary advantage is ablility to run this as separate
 		// go routine
-		deleteCallback(v)
+		cfg.onDeleteItem(v, reason)
 	}
-	bucket.Lock()
-	defer bucket.Unlock()
+	s.Lock()
+	defer s.Unlock()
 	bucket.log("Deleting item with key: " + key + " created on " + v.Created().String())
-	delete(bucket.items, key)
+	s.untrackLocked(key, s.sizeOfLocked(v, cfg.costFunc))
+	s.store.Delete(key)
+	s.countEviction(reason)
 	return v, nil
 }
 
 func (bucket *MaceBucket) Cache(key string, alive time.Duration,
 	data interface{}) *MaceItem {
 	item := NewMaceItem(key, data, alive)
-	bucket.Lock()
+	s := bucket.shardFor(key)
+	cfg := bucket.snapshotConfig()
+
+	s.Lock()
 	bucket.log("Adding item with key: " + key +
 		" which will be alive for:" + alive.String())
-	bucket.items[key] = item
-	if item.alive != 0 {
-		heap.Push(bucket.leakqueue, item.dispose)
+	if cfg.costFunc != nil {
+		if old, ok := s.store.Get(key); ok {
+			s.totalBytes -= s.sizeOfLocked(old, cfg.costFunc)
+		}
+	}
+	s.store.Set(key, item)
+	if item.alive != 0 && s.usesLeakQueue() {
+		heap.Push(s.leakqueue, item.dispose)
+	}
+	s.totalBytes += s.sizeOfLocked(item, cfg.costFunc)
+	s.touchLocked(key, cfg.policy)
+	victims := s.evictLocked(cfg.policy, cfg.capacity, cfg.maxBytes, cfg.costFunc)
+	expiry := s.leakInterval
+	s.Unlock()
+
+	for _, victim := range victims {
+		bucket.log("Evicting item with key: " + victim.Key() + " to honor capacity on bucket " + bucket.name)
+		s.countEviction(EvictionReasonCapacity)
+		if cfg.onDeleteItem != nil {
+			// Victims are already removed from the shard's store at
+			// this point, so this fires after the fact rather than
+			// going through delete().
+			cfg.onDeleteItem(victim, EvictionReasonCapacity)
+		}
 	}
-	expiry := bucket.leakInterval
-	addCallback := bucket.onAddItem
-	bucket.Unlock()
 
-	if addCallback != nil {
+	if cfg.onAddItem != nil {
 		// TODO: clone item and call addCallback as a go routine
-		addCallback(item)
+		cfg.onAddItem(item)
 	}
-	// Leak check set or run
-	if alive > 0 && (expiry == 0 || alive < expiry) {
-		bucket.leakCheck()
+	// Leak check set or run. In scavenger mode (see SetScavenger) expiry
+	// is handled by periodic sweeps instead, so skip the per-insert
+	// reprogramming.
+	if !s.scavenging && alive > 0 && (expiry == 0 || alive < expiry) {
+		bucket.leakCheck(s)
 	}
 
 	return item
 }
 
 func (bucket *MaceBucket) Exists(key string) bool {
-	bucket.RLock()
-	defer bucket.RUnlock()
-	_, ok := bucket.items[key]
+	s := bucket.shardFor(key)
+	s.RLock()
+	defer s.RUnlock()
+	_, ok := s.store.Get(key)
 	return ok
 }
 
+// Value looks up key, falling back to the configured data loader (see
+// GetOrLoad in getorload.go) on a miss.
 func (bucket *MaceBucket) Value(key string) (*MaceItem, error) {
-	bucket.RLock()
-	v, ok := bucket.items[key]
-	loadItems := bucket.loadItems
-	bucket.RUnlock()
-	if ok {
-		v.KeepAlive()
-		// We care to update LeakQueue only if it has Alive duration
-		// set
-		if v.Alive() != 0 {
-			bucket.Lock()
-			bucket.leakqueue.update(v.dispose)
-			bucket.Unlock()
-		}
-		return v, nil
-	}
-	if loadItems != nil {
-		item := loadItems(key)
-		if item != nil {
-			bucket.Cache(key, item.Alive(), item.data)
-			return item, nil
-		}
-		return nil, ErrKeyNotFoundOrLoadable
-	}
-	return nil, ErrKeyNotFound
+	return bucket.fetch(key)
 }
 
 func (bucket *MaceBucket) Flush() {
-	bucket.Lock()
-	defer bucket.Unlock()
 	bucket.log("Flushing the cache bucket: " + bucket.name)
-	bucket.items = make(map[string]*MaceItem)
-	l := leakQueue{}
-	heap.Init(&l)
-	bucket.leakqueue = &l
-	bucket.leakInterval = 0
-	if bucket.leakTimer != nil {
-		bucket.leakTimer.Stop()
-	}
-	return
-}
-
-func (bucket *MaceBucket) log(v ...interface{}) {
-	if bucket.logger == nil {
-		return
+	for _, s := range bucket.shards {
+		s.Lock()
+		s.store.Flush()
+		l := leakQueue{}
+		heap.Init(&l)
+		s.leakqueue = &l
+		s.leakInterval = 0
+		if s.leakTimer != nil {
+			s.leakTimer.Stop()
+		}
+		s.resetEvictionStateLocked()
+		s.Unlock()
 	}
-	bucket.logger.Println(v)
 }
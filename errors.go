@@ -0,0 +1,11 @@
+package mace
+
+import "errors"
+
+// ErrKeyNotFound is returned when a key isn't cached and no data loader
+// is configured to produce it.
+var ErrKeyNotFound = errors.New("mace: key not found")
+
+// ErrKeyNotFoundOrLoadable is returned when a key isn't cached and the
+// configured data loader either has nothing for it or returned nil.
+var ErrKeyNotFoundOrLoadable = errors.New("mace: key not found or loadable")
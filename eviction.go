@@ -0,0 +1,244 @@
+package mace
+
+import "container/list"
+
+// EvictionPolicy selects the strategy used to pick a victim when a
+// shard is over its configured capacity.
+type EvictionPolicy int
+
+const (
+	// EvictionNone disables capacity-based eviction (the default).
+	EvictionNone EvictionPolicy = iota
+	// EvictionLRU evicts the least recently used item.
+	EvictionLRU
+	// EvictionLFU evicts the least frequently used item.
+	EvictionLFU
+	// EvictionSegmentedLRU keeps newly inserted keys in a probationary
+	// segment and only promotes keys to the protected segment on a second
+	// access, which makes scan-resistant workloads cheaper to cache
+	// correctly. Neither segment has its own size limit: victims come from
+	// the probationary segment first, and from the protected segment only
+	// once the probationary one is empty.
+	EvictionSegmentedLRU
+)
+
+// EvictionReason is passed to onDeleteItem so callers can tell an expiry
+// apart from a capacity-driven eviction or a manual Delete.
+type EvictionReason int
+
+const (
+	// EvictionReasonExpired means the item's TTL elapsed.
+	EvictionReasonExpired EvictionReason = iota
+	// EvictionReasonCapacity means the item was evicted to stay within
+	// the configured capacity or byte budget.
+	EvictionReasonCapacity
+	// EvictionReasonManual means the item was removed via Delete. Flush
+	// clears a bucket without calling onDeleteItem for the items it drops.
+	EvictionReasonManual
+)
+
+// CostFunc estimates the size, in bytes, of an item. It is used by
+// SetMaxBytes to bound a bucket by approximate memory usage rather than
+// item count.
+type CostFunc func(*MaceItem) int64
+
+// segment identifies which list a key's LRU node currently lives in when
+// EvictionSegmentedLRU is active.
+type segment int
+
+const (
+	segmentProbationary segment = iota
+	segmentProtected
+)
+
+// lruNode is the value stored in the LRU/SLRU linked list elements.
+type lruNode struct {
+	key     string
+	segment segment
+}
+
+// SetCapacity bounds each shard to at most n items (n <= 0 disables the
+// limit) and selects the policy used to choose a victim when a shard
+// would otherwise grow past it.
+//
+// n is a PER-SHARD budget, not a bucket-wide one: a bucket opened the
+// normal way via Mace(name, "mem://") gets defaultShardCount() shards
+// (2*runtime.NumCPU(), rounded up to a power of two), so
+// SetCapacity(1000, EvictionLRU) on an 8-core box admits roughly 16,000
+// items, not 1,000, before anything is evicted. Callers that need an
+// exact bucket-wide bound should open the bucket with a single shard via
+// an explicit DSN store that doesn't shard (e.g. "file://" or a remote
+// store), or divide n by the shard count themselves.
+// Changing the policy resets eviction bookkeeping, not the items
+// already cached.
+func (bucket *MaceBucket) SetCapacity(n int, policy EvictionPolicy) {
+	bucket.cfgMu.Lock()
+	bucket.capacity = n
+	bucket.policy = policy
+	bucket.cfgMu.Unlock()
+	for _, s := range bucket.shards {
+		s.Lock()
+		s.resetEvictionStateLocked()
+		s.Unlock()
+	}
+}
+
+// SetCostFunc installs a hook used to estimate an item's size in bytes.
+// Combined with SetMaxBytes this lets callers bound a bucket by
+// approximate memory usage instead of, or in addition to, item count.
+func (bucket *MaceBucket) SetCostFunc(f CostFunc) {
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
+	bucket.costFunc = f
+}
+
+// SetMaxBytes bounds each shard to at most n bytes, as estimated by the
+// CostFunc installed via SetCostFunc (n <= 0 disables the limit). As
+// with SetCapacity, this is a per-shard budget. The budget is only
+// enforced once SetCapacity has selected a policy other than
+// EvictionNone, since that policy is what picks the victims.
+func (bucket *MaceBucket) SetMaxBytes(n int64) {
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
+	bucket.maxBytes = n
+}
+
+// resetEvictionStateLocked (re)initializes the data structures backing
+// the configured eviction policy. Callers must hold s.Lock().
+func (s *shard) resetEvictionStateLocked() {
+	s.lruList = list.New()
+	s.lruElems = make(map[string]*list.Element)
+	s.protected = list.New()
+	s.freq = newFreqQueue()
+	s.totalBytes = 0
+}
+
+// touchLocked records a cache insertion or access for whichever eviction
+// policy is active. Callers must hold s.Lock().
+func (s *shard) touchLocked(key string, policy EvictionPolicy) {
+	switch policy {
+	case EvictionLRU:
+		s.touchLRULocked(key)
+	case EvictionSegmentedLRU:
+		s.touchSLRULocked(key)
+	case EvictionLFU:
+		if s.freq == nil {
+			s.resetEvictionStateLocked()
+		}
+		s.freq.touch(key)
+	}
+}
+
+func (s *shard) touchLRULocked(key string) {
+	if s.lruList == nil {
+		s.resetEvictionStateLocked()
+	}
+	if el, ok := s.lruElems[key]; ok {
+		s.lruList.MoveToFront(el)
+		return
+	}
+	s.lruElems[key] = s.lruList.PushFront(&lruNode{key: key})
+}
+
+func (s *shard) touchSLRULocked(key string) {
+	if s.lruList == nil {
+		s.resetEvictionStateLocked()
+	}
+	if el, ok := s.lruElems[key]; ok {
+		n := el.Value.(*lruNode)
+		if n.segment == segmentProtected {
+			s.protected.MoveToFront(el)
+			return
+		}
+		// Second access: promote from probationary to protected.
+		s.lruList.Remove(el)
+		n.segment = segmentProtected
+		s.lruElems[key] = s.protected.PushFront(n)
+		return
+	}
+	n := &lruNode{key: key, segment: segmentProbationary}
+	s.lruElems[key] = s.lruList.PushFront(n)
+}
+
+// untrackLocked removes a key from whichever eviction bookkeeping is
+// active, typically on Delete. Callers must hold s.Lock().
+func (s *shard) untrackLocked(key string, size int64) {
+	s.totalBytes -= size
+	if el, ok := s.lruElems[key]; ok {
+		n := el.Value.(*lruNode)
+		if n.segment == segmentProtected {
+			s.protected.Remove(el)
+		} else {
+			s.lruList.Remove(el)
+		}
+		delete(s.lruElems, key)
+	}
+	if s.freq != nil {
+		s.freq.remove(key)
+	}
+}
+
+// sizeOfLocked estimates an item's cost in bytes via costFunc, or 0 if
+// none is set.
+func (s *shard) sizeOfLocked(item *MaceItem, costFunc CostFunc) int64 {
+	if costFunc == nil {
+		return 0
+	}
+	return costFunc(item)
+}
+
+// victimLocked picks the next key to evict under the configured policy.
+// Callers must hold s.Lock(). Returns "" if there is nothing to evict.
+func (s *shard) victimLocked(policy EvictionPolicy) string {
+	switch policy {
+	case EvictionLRU:
+		if el := s.lruList.Back(); el != nil {
+			return el.Value.(*lruNode).key
+		}
+	case EvictionSegmentedLRU:
+		if el := s.lruList.Back(); el != nil {
+			return el.Value.(*lruNode).key
+		}
+		if el := s.protected.Back(); el != nil {
+			return el.Value.(*lruNode).key
+		}
+	case EvictionLFU:
+		return s.freq.min()
+	}
+	return ""
+}
+
+// evictLocked evicts items until the shard is within its configured
+// capacity and byte budget, or there is nothing left to evict. It
+// returns the evicted items, already removed from the shard's store, so
+// the caller can fire onDeleteItem once the lock is released.
+func (s *shard) evictLocked(policy EvictionPolicy, capacity int, maxBytes int64, costFunc CostFunc) []*MaceItem {
+	if policy == EvictionNone {
+		return nil
+	}
+	var victims []*MaceItem
+	for s.overBudgetLocked(capacity, maxBytes) {
+		key := s.victimLocked(policy)
+		if key == "" {
+			break
+		}
+		item, ok := s.store.Get(key)
+		if !ok {
+			break
+		}
+		s.untrackLocked(key, s.sizeOfLocked(item, costFunc))
+		s.store.Delete(key)
+		victims = append(victims, item)
+	}
+	return victims
+}
+
+func (s *shard) overBudgetLocked(capacity int, maxBytes int64) bool {
+	if capacity > 0 && s.store.Len() > capacity {
+		return true
+	}
+	if maxBytes > 0 && s.totalBytes > maxBytes {
+		return true
+	}
+	return false
+}
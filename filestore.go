@@ -0,0 +1,155 @@
+package mace
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	RegisterStoreFactory("file", func(dsn string) (Store, error) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("mace: invalid dsn %q: %v", dsn, err)
+		}
+		return newFileStore(u.Path)
+	})
+}
+
+// fileRecord is the on-disk representation of a cached item: just enough
+// to reconstruct it via NewMaceItem, since fileStore never reaches into
+// MaceItem's own internals.
+type fileRecord struct {
+	Data    interface{}
+	Created time.Time
+	Alive   time.Duration
+}
+
+// fileStore persists one file per key under dir, named after the key's
+// filepath-escaped form, and keeps a read-through in-memory index so Len
+// and Iter don't have to walk the directory on every call. Values are
+// gob-encoded, so non-builtin interface{} payloads must be registered
+// with gob.Register the same way any other gob value would be.
+type fileStore struct {
+	dir   string
+	index map[string]*MaceItem
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mace: file store dsn must include a path, e.g. file:///var/cache/mace")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &fileStore{dir: dir, index: make(map[string]*MaceItem)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		key, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		item, err := s.readFile(key)
+		if err != nil {
+			continue
+		}
+		s.index[key] = item
+	}
+	return s, nil
+}
+
+func (s *fileStore) pathFor(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key))
+}
+
+func (s *fileStore) readFile(key string) (*MaceItem, error) {
+	raw, err := os.ReadFile(s.pathFor(key))
+	if err != nil {
+		return nil, err
+	}
+	var rec fileRecord
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&rec); err != nil {
+		return nil, err
+	}
+	if rec.Alive == 0 {
+		return NewMaceItem(key, rec.Data, 0), nil
+	}
+	remaining := rec.Alive - time.Since(rec.Created)
+	if remaining <= 0 {
+		os.Remove(s.pathFor(key))
+		return nil, fmt.Errorf("mace: %q expired on disk", key)
+	}
+	return NewMaceItem(key, rec.Data, remaining), nil
+}
+
+func (s *fileStore) writeFile(key string, item *MaceItem) error {
+	var buf bytes.Buffer
+	rec := fileRecord{Data: item.Data(), Created: item.Created(), Alive: item.Alive()}
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return err
+	}
+	return os.WriteFile(s.pathFor(key), buf.Bytes(), 0o644)
+}
+
+// Get reports a miss for an item whose TTL has elapsed, the same
+// contract memStore gets for free from the bucket's leak queue. fileStore
+// isn't a memStore, so usesLeakQueue (bucket.go) skips it and the only
+// other expiry check is the one-time sweep in newFileStore at startup;
+// without this, a file-backed item would never expire for the life of
+// the process. Get is called under the shard's RLock (same as memStore),
+// so it only reads here — the stale index entry and on-disk file are
+// cleaned up lazily, on the next Set for the same key or Flush, rather
+// than mutating state under a lock shared with concurrent readers.
+func (s *fileStore) Get(key string) (*MaceItem, bool) {
+	v, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+	if v.Alive() != 0 && time.Since(v.Created()) >= v.Alive() {
+		return nil, false
+	}
+	return v, true
+}
+
+func (s *fileStore) Set(key string, item *MaceItem) {
+	s.index[key] = item
+	if err := s.writeFile(key, item); err != nil {
+		// The in-memory index stays authoritative even if the disk
+		// write failed; the item just won't survive a restart.
+		_ = err
+	}
+}
+
+func (s *fileStore) Delete(key string) {
+	delete(s.index, key)
+	os.Remove(s.pathFor(key))
+}
+
+func (s *fileStore) Iter() []*MaceItem {
+	out := make([]*MaceItem, 0, len(s.index))
+	for _, v := range s.index {
+		out = append(out, v)
+	}
+	return out
+}
+
+func (s *fileStore) Len() int {
+	return len(s.index)
+}
+
+func (s *fileStore) Flush() {
+	for key := range s.index {
+		os.Remove(s.pathFor(key))
+	}
+	s.index = make(map[string]*MaceItem)
+}
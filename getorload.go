@@ -0,0 +1,102 @@
+package mace
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetNegativeCacheTTL makes a miss where the data loader returns nil get
+// remembered for ttl, so a thundering herd of lookups for a key that
+// doesn't exist doesn't re-invoke the loader on every single call. ttl
+// <= 0 disables negative caching (the default): every miss calls the
+// loader again, same as before GetOrLoad existed.
+func (bucket *MaceBucket) SetNegativeCacheTTL(ttl time.Duration) {
+	bucket.cfgMu.Lock()
+	defer bucket.cfgMu.Unlock()
+	bucket.negativeCacheTTL = ttl
+}
+
+// GetOrLoad looks key up exactly as Value does, with the data loader call
+// single-flighted: if N goroutines miss on the same key concurrently, the
+// loader set via SetDataLoader runs exactly once and all N get its
+// result. Value goes through the same path, so it coalesces misses too.
+func (bucket *MaceBucket) GetOrLoad(key string) (*MaceItem, error) {
+	return bucket.fetch(key)
+}
+
+// fetch backs both Value and GetOrLoad: look the key up, and on a miss
+// run the data loader through the shard's loadGroup so concurrent misses
+// for the same key coalesce into a single call.
+func (bucket *MaceBucket) fetch(key string) (*MaceItem, error) {
+	s := bucket.shardFor(key)
+	s.RLock()
+	v, ok := s.store.Get(key)
+	s.RUnlock()
+	if ok {
+		atomic.AddInt64(&s.stats.hits, 1)
+		cfg := bucket.snapshotConfig()
+		s.Lock()
+		v.KeepAlive()
+		// We care to update LeakQueue only if it has Alive duration
+		// set
+		if v.Alive() != 0 && s.usesLeakQueue() {
+			s.refreshDispose(v)
+		}
+		s.touchLocked(key, cfg.policy)
+		s.Unlock()
+		return v, nil
+	}
+	atomic.AddInt64(&s.stats.misses, 1)
+
+	cfg := bucket.snapshotConfig()
+	if cfg.loadItems == nil {
+		return nil, ErrKeyNotFound
+	}
+	if s.negativeHit(key) {
+		return nil, ErrKeyNotFoundOrLoadable
+	}
+	return s.loadGroup.Do(key, func() (*MaceItem, error) {
+		start := time.Now()
+		loaded := cfg.loadItems(key)
+		elapsed := time.Since(start)
+		atomic.AddInt64(&s.stats.loadNanos, int64(elapsed))
+		atomic.AddInt64(&s.stats.loads, 1)
+		s.recordLoadLatency(elapsed)
+		if loaded == nil {
+			atomic.AddInt64(&s.stats.loadErrors, 1)
+			s.recordNegative(key, cfg.negativeCacheTTL)
+			return nil, ErrKeyNotFoundOrLoadable
+		}
+		return bucket.Cache(key, loaded.Alive(), loaded.data), nil
+	})
+}
+
+// negativeHit reports whether key is within its negative-cache window.
+func (s *shard) negativeHit(key string) bool {
+	s.negMu.Lock()
+	defer s.negMu.Unlock()
+	expiry, ok := s.negatives[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(s.negatives, key)
+		return false
+	}
+	return true
+}
+
+// recordNegative remembers that the loader just returned nil for key, for
+// ttl. A non-positive ttl is a no-op, matching SetNegativeCacheTTL's
+// "disabled by default" contract.
+func (s *shard) recordNegative(key string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	s.negMu.Lock()
+	defer s.negMu.Unlock()
+	if s.negatives == nil {
+		s.negatives = make(map[string]time.Time)
+	}
+	s.negatives[key] = time.Now().Add(ttl)
+}
@@ -0,0 +1,72 @@
+package mace
+
+import (
+	"sync"
+	"time"
+)
+
+// MaceItem is one cached value plus the bookkeeping needed to expire it:
+// when it was created, how long it lives for, and (for keys with a TTL)
+// the disposeItem tracking its place in the owning shard's leak queue.
+type MaceItem struct {
+	mu sync.RWMutex
+
+	key       string
+	data      interface{}
+	createdOn time.Time
+	alive     time.Duration
+	dispose   *disposeItem
+}
+
+// NewMaceItem creates an item that expires alive after creation, or
+// never expires if alive is 0.
+func NewMaceItem(key string, data interface{}, alive time.Duration) *MaceItem {
+	now := time.Now()
+	item := &MaceItem{
+		key:       key,
+		data:      data,
+		createdOn: now,
+		alive:     alive,
+	}
+	if alive != 0 {
+		item.dispose = &disposeItem{disposeTime: now.Add(alive), value: key}
+	}
+	return item
+}
+
+// Key returns the item's cache key.
+func (item *MaceItem) Key() string {
+	return item.key
+}
+
+// Data returns the item's cached value.
+func (item *MaceItem) Data() interface{} {
+	return item.data
+}
+
+// Alive returns the TTL this item was created or last kept alive with, or
+// 0 if it never expires.
+func (item *MaceItem) Alive() time.Duration {
+	return item.alive
+}
+
+// Created returns when this item was created, or last touched via
+// KeepAlive.
+func (item *MaceItem) Created() time.Time {
+	item.mu.RLock()
+	defer item.mu.RUnlock()
+	return item.createdOn
+}
+
+// KeepAlive resets the item's creation time to now, extending its TTL
+// (if any) by another full Alive() from this point. It does not touch
+// the item's place in its shard's leak queue — item.dispose.disposeTime
+// is owned by the shard lock, not item.mu, since the leak queue reads it
+// under s.Lock() (see leakCheck in bucket.go); callers that need the
+// leak queue refreshed too must also call shard.refreshDispose while
+// holding that lock (see fetch in getorload.go).
+func (item *MaceItem) KeepAlive() {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	item.createdOn = time.Now()
+}
@@ -0,0 +1,12 @@
+package mace
+
+// Peek returns the item closest to expiry without removing it from the
+// queue, or nil if the queue is empty. leakCheck uses it to decide
+// whether there's anything ready to pop without doing a Pop/Push round
+// trip just to look.
+func (l *leakQueue) Peek() *disposeItem {
+	if l.Len() == 0 {
+		return nil
+	}
+	return (*l)[0]
+}
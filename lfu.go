@@ -0,0 +1,80 @@
+package mace
+
+import "container/heap"
+
+// freqItem tracks how many times a key has been accessed, for the LFU
+// eviction policy. index is maintained by freqHeap to support in-place
+// updates via heap.Fix, mirroring leakQueue's use of container/heap.
+type freqItem struct {
+	key   string
+	count int64
+	index int
+}
+
+type freqHeap []*freqItem
+
+func (h freqHeap) Len() int           { return len(h) }
+func (h freqHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h freqHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *freqHeap) Push(x interface{}) {
+	item := x.(*freqItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *freqHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// freqQueue is the bucket-side bookkeeping backing EvictionLFU: a min-heap
+// of access counts keyed by item, updated on every cache hit.
+type freqQueue struct {
+	h     freqHeap
+	items map[string]*freqItem
+}
+
+func newFreqQueue() *freqQueue {
+	return &freqQueue{items: make(map[string]*freqItem)}
+}
+
+// touch records an access to key, creating its entry with count 1 if this
+// is the first time it is seen.
+func (q *freqQueue) touch(key string) {
+	if it, ok := q.items[key]; ok {
+		it.count++
+		heap.Fix(&q.h, it.index)
+		return
+	}
+	it := &freqItem{key: key, count: 1}
+	q.items[key] = it
+	heap.Push(&q.h, it)
+}
+
+// remove drops key from the queue, if present.
+func (q *freqQueue) remove(key string) {
+	it, ok := q.items[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&q.h, it.index)
+	delete(q.items, key)
+}
+
+// min returns the key with the lowest access count, or "" if the queue is
+// empty.
+func (q *freqQueue) min() string {
+	if q.h.Len() == 0 {
+		return ""
+	}
+	return q.h[0].key
+}
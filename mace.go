@@ -0,0 +1,51 @@
+package mace
+
+// Mace returns the named cache bucket backed by the store selected by
+// dsn. dsn follows a simple scheme://... convention:
+//
+//	""  or "mem://"           in-memory map (default, fastest)
+//	"file:///path/to/dir"     one file per key under the given directory
+//
+// Additional schemes (redis://, memcache://, ...) are NOT auto-registered
+// by a driver string like "redis://host:6379/0" — mace stays free of any
+// driver dependency, so a caller that wants one must register a factory
+// themselves via RegisterStoreFactory, wrapping their own client behind
+// RedisClient/MemcacheClient (see remotestore.go). Likewise file:// does
+// not parse a byte-budget query parameter (e.g. "?maxBytes=64MB") out of
+// a DSN; use SetMaxBytes/SetCostFunc for that instead.
+//
+// A "mem" bucket is split across runtime.NumCPU()*2 shards, rounded up
+// to a power of two (see defaultShardCount in shard.go), so that concurrent callers touching different keys don't
+// contend on the same lock. Other backends keep a single shard: their
+// bottleneck is the backend round-trip, not an in-process mutex, and a
+// single shard lets them share one connection/index instead of each
+// shard re-discovering the same remote state.
+func Mace(name, dsn string) *MaceBucket {
+	n := 1
+	if schemeOf(dsn) == "mem" {
+		n = defaultShardCount()
+	}
+	return newBucket(name, dsn, n)
+}
+
+func newBucket(name, dsn string, numShards int) *MaceBucket {
+	if numShards < 1 {
+		numShards = 1
+	}
+	shards := make([]*shard, numShards)
+	for i := range shards {
+		s, err := newShard(dsn)
+		if err != nil {
+			// A bad DSN is a programmer error the caller should fix;
+			// fall back to the in-memory store rather than handing
+			// back a bucket that can never look anything up.
+			s, _ = newShard("")
+		}
+		shards[i] = s
+	}
+	return &MaceBucket{
+		name:   name,
+		dsn:    dsn,
+		shards: shards,
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"math/rand"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -22,7 +24,7 @@ var (
 )
 
 func TestMaceCache(t *testing.T) {
-	bucket := Mace("testMace")
+	bucket := Mace("testMace", "mem://")
 	bucket.Cache(k, 1*time.Second, v)
 	p, err := bucket.Value(k)
 	if err != nil || p == nil || p.Data().(string) != v {
@@ -31,7 +33,7 @@ func TestMaceCache(t *testing.T) {
 }
 
 func TestMaceCacheExpire(t *testing.T) {
-	bucket := Mace("testMaceExpire")
+	bucket := Mace("testMaceExpire", "mem://")
 	bucket.Cache(k, 250*time.Millisecond, v)
 	p, err := bucket.Value(k)
 	if err != nil || p == nil || p.Data().(string) != v {
@@ -46,7 +48,7 @@ func TestMaceCacheExpire(t *testing.T) {
 }
 
 func TestMaceCacheNonExpiring(t *testing.T) {
-	bucket := Mace("testMaceNonExpiring")
+	bucket := Mace("testMaceNonExpiring", "mem://")
 	bucket.Cache(k, 0, v)
 	time.Sleep(500 * time.Millisecond)
 	p, err := bucket.Value(k)
@@ -58,7 +60,7 @@ func TestMaceCacheNonExpiring(t *testing.T) {
 func TestMaceCacheKeepAlive(t *testing.T) {
 	k2 := k + k
 	v2 := v + v
-	bucket := Mace("testMaceKeepAlive")
+	bucket := Mace("testMaceKeepAlive", "mem://")
 	bucket.Cache(k, 250*time.Millisecond, v)
 	bucket.Cache(k2, 750*time.Millisecond, v2)
 
@@ -86,7 +88,7 @@ func TestMaceCacheKeepAlive(t *testing.T) {
 }
 
 func TestMaceExists(t *testing.T) {
-	bucket := Mace("testMaceExists")
+	bucket := Mace("testMaceExists", "mem://")
 	bucket.Cache(k, 0, v)
 	if !bucket.Exists(k) {
 		t.Error("Error verifying existing data in cache")
@@ -94,7 +96,7 @@ func TestMaceExists(t *testing.T) {
 }
 
 func TestMaceDelete(t *testing.T) {
-	bucket := Mace("testMaceDelete")
+	bucket := Mace("testMaceDelete", "mem://")
 	bucket.Cache(k, 0, v)
 	p, err := bucket.Value(k)
 	if err != nil || p == nil || p.Data().(string) != v {
@@ -108,7 +110,7 @@ func TestMaceDelete(t *testing.T) {
 }
 
 func TestMaceFlush(t *testing.T) {
-	bucket := Mace("testMaceFlush")
+	bucket := Mace("testMaceFlush", "mem://")
 	bucket.Cache(k, 10*time.Second, v)
 	time.Sleep(100 * time.Millisecond)
 	bucket.Flush()
@@ -123,7 +125,7 @@ func TestMaceFlush(t *testing.T) {
 }
 
 func TestMaceFlushNoTimout(t *testing.T) {
-	bucket := Mace("testMaceFlushNoTimeout")
+	bucket := Mace("testMaceFlushNoTimeout", "mem://")
 	bucket.Cache(k, 10*time.Second, v)
 	bucket.Flush()
 
@@ -138,7 +140,7 @@ func TestMaceFlushNoTimout(t *testing.T) {
 
 func TestMaceCount(t *testing.T) {
 	count := 100000
-	bucket := Mace("testCount")
+	bucket := Mace("testCount", "mem://")
 	for i := 0; i < count; i++ {
 		key := k + strconv.Itoa(i)
 		bucket.Cache(key, 10*time.Second, v)
@@ -156,7 +158,7 @@ func TestMaceCount(t *testing.T) {
 }
 
 func TestMaceDataLoader(t *testing.T) {
-	bucket := Mace("testMaceDataLoader")
+	bucket := Mace("testMaceDataLoader", "mem://")
 	bucket.SetDataLoader(func(key string) *MaceItem {
 		var item *MaceItem
 		if key != "nil" {
@@ -183,30 +185,429 @@ func TestMaceDataLoader(t *testing.T) {
 }
 
 func TestMaceCallbacks(t *testing.T) {
+	var mu sync.Mutex
 	addedKey := ""
 	removedKey := ""
 
-	bucket := Mace("testMaceCallbacks")
+	bucket := Mace("testMaceCallbacks", "mem://")
 	bucket.SetOnAddItem(func(item *MaceItem) {
+		mu.Lock()
+		defer mu.Unlock()
 		addedKey = item.Key()
 	})
-	bucket.SetOnDeleteItem(func(item *MaceItem) {
+	bucket.SetOnDeleteItem(func(item *MaceItem, reason EvictionReason) {
+		mu.Lock()
+		defer mu.Unlock()
 		removedKey = item.Key()
+		if reason != EvictionReasonExpired {
+			t.Errorf("Expected expiry eviction reason, got %v", reason)
+		}
 	})
 
 	bucket.Cache(k, 500*time.Millisecond, v)
 
 	time.Sleep(250 * time.Millisecond)
-	if addedKey != k {
+	mu.Lock()
+	got := addedKey
+	mu.Unlock()
+	if got != k {
 		t.Error("AddedItem callback not working")
 	}
 
 	time.Sleep(500 * time.Millisecond)
-	if removedKey != k {
-		t.Error("AboutToDeleteItem callback not working:" + k + "_" + removedKey)
+	mu.Lock()
+	got = removedKey
+	mu.Unlock()
+	if got != k {
+		t.Error("AboutToDeleteItem callback not working:" + k + "_" + got)
+	}
+}
+
+func TestMaceCapacityLRU(t *testing.T) {
+	bucket := newBucket("testMaceCapacityLRU", "mem://", 1)
+	bucket.SetCapacity(2, EvictionLRU)
+
+	bucket.Cache("a", 0, "1")
+	bucket.Cache("b", 0, "2")
+	bucket.Value("a") // touch a so b is the least recently used
+	bucket.Cache("c", 0, "3")
+
+	if bucket.Exists("b") {
+		t.Error("Expected least recently used key 'b' to be evicted")
+	}
+	if !bucket.Exists("a") || !bucket.Exists("c") {
+		t.Error("Expected recently used keys to survive eviction")
+	}
+	if bucket.Count() != 2 {
+		t.Error("Expected bucket to stay within configured capacity")
+	}
+}
+
+func TestMaceCapacityLFU(t *testing.T) {
+	bucket := newBucket("testMaceCapacityLFU", "mem://", 1)
+	bucket.SetCapacity(2, EvictionLFU)
+
+	bucket.Cache("a", 0, "1")
+	bucket.Cache("b", 0, "2")
+	bucket.Value("a")
+	bucket.Value("a")
+	bucket.Cache("c", 0, "3")
+
+	if bucket.Exists("b") {
+		t.Error("Expected least frequently used key 'b' to be evicted")
+	}
+	if !bucket.Exists("a") || !bucket.Exists("c") {
+		t.Error("Expected frequently used keys to survive eviction")
+	}
+}
+
+func TestMaceCapacityEvictionReason(t *testing.T) {
+	var reason EvictionReason
+	bucket := newBucket("testMaceCapacityEvictionReason", "mem://", 1)
+	bucket.SetCapacity(1, EvictionLRU)
+	bucket.SetOnDeleteItem(func(item *MaceItem, r EvictionReason) {
+		reason = r
+	})
+
+	bucket.Cache("a", 0, "1")
+	bucket.Cache("b", 0, "2")
+
+	if reason != EvictionReasonCapacity {
+		t.Error("Expected capacity eviction reason, got", reason)
+	}
+}
+
+func TestMaceMaxBytes(t *testing.T) {
+	bucket := newBucket("testMaceMaxBytes", "mem://", 1)
+	bucket.SetCapacity(0, EvictionLRU)
+	bucket.SetCostFunc(func(item *MaceItem) int64 {
+		return int64(len(item.Data().(string)))
+	})
+	bucket.SetMaxBytes(5)
+
+	bucket.Cache("a", 0, "123")
+	bucket.Cache("b", 0, "123")
+
+	if bucket.Exists("a") {
+		t.Error("Expected oldest key to be evicted once over the byte budget")
+	}
+	if !bucket.Exists("b") {
+		t.Error("Expected most recent key to survive")
+	}
+}
+
+// TestMaceCapacityIsPerShard exercises SetCapacity through the public
+// Mace() constructor, with its real default shard count, to confirm
+// (and pin down) the per-shard multiplier documented on SetCapacity:
+// a capacity of n admits roughly n*shards items, not exactly n.
+func TestMaceCapacityIsPerShard(t *testing.T) {
+	bucket := Mace("testMaceCapacityIsPerShard", "mem://")
+	shards := len(bucket.shards)
+	bucket.SetCapacity(1, EvictionLRU)
+
+	// Enough distinct keys that, with capacity 1 per shard, every shard
+	// ends up holding its own most-recently-inserted item.
+	for i := 0; i < 50*shards; i++ {
+		bucket.Cache("k"+strconv.Itoa(i), 0, v)
+	}
+
+	if got := bucket.Count(); got <= 1 || got > shards {
+		t.Errorf("Expected capacity 1 on a %d-shard bucket to hold somewhere between 2 and %d items (one per shard), got %d", shards, shards, got)
+	}
+}
+
+func TestMaceFileStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mace-filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket := Mace("testMaceFileStore", "file://"+dir)
+	bucket.Cache(k, 0, v)
+	p, err := bucket.Value(k)
+	if err != nil || p == nil || p.Data().(string) != v {
+		t.Error("Error retrieving data from cache", err)
+	}
+
+	// A second bucket pointed at the same directory should see the
+	// item persisted by the first.
+	reopened := Mace("testMaceFileStoreReopened", "file://"+dir)
+	p, err = reopened.Value(k)
+	if err != nil || p == nil || p.Data().(string) != v {
+		t.Error("Error recovering data from a reopened file store", err)
+	}
+}
+
+func TestMaceFileStoreExpiry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mace-filestore-expiry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket := Mace("testMaceFileStoreExpiry", "file://"+dir)
+	bucket.Cache(k, 100*time.Millisecond, v)
+	time.Sleep(300 * time.Millisecond)
+
+	if _, err := bucket.Value(k); err == nil {
+		t.Error("Expected a file-backed item to expire like any other TTL'd item")
+	}
+}
+
+func TestMaceUnknownStoreScheme(t *testing.T) {
+	// An unregistered scheme falls back to the in-memory store rather
+	// than handing back an unusable bucket.
+	bucket := Mace("testMaceUnknownScheme", "redis://localhost:6379/0")
+	bucket.Cache(k, 0, v)
+	if !bucket.Exists(k) {
+		t.Error("Expected fallback to the in-memory store for an unregistered scheme")
+	}
+}
+
+func TestMaceGetOrLoadCoalesces(t *testing.T) {
+	var calls int64
+	bucket := Mace("testMaceGetOrLoadCoalesces", "mem://")
+	bucket.SetDataLoader(func(key string) *MaceItem {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return NewMaceItem(key, key, 0)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := bucket.GetOrLoad(k)
+			if err != nil || p == nil || p.Data().(string) != k {
+				t.Error("Error loading value via GetOrLoad", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("Expected the loader to run exactly once under a thundering herd, ran %d times", calls)
+	}
+}
+
+func TestMaceNegativeCache(t *testing.T) {
+	var calls int64
+	bucket := Mace("testMaceNegativeCache", "mem://")
+	bucket.SetNegativeCacheTTL(200 * time.Millisecond)
+	bucket.SetDataLoader(func(key string) *MaceItem {
+		atomic.AddInt64(&calls, 1)
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		_, err := bucket.Value("nil")
+		if err == nil {
+			t.Error("Expected an error for a key the loader can't produce")
+		}
+	}
+	if atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("Expected the negative result to be remembered instead of reinvoking the loader, ran %d times", calls)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	bucket.Value("nil")
+	if atomic.LoadInt64(&calls) != 2 {
+		t.Error("Expected the loader to run again once the negative cache TTL elapsed")
 	}
 }
 
+func TestMaceStats(t *testing.T) {
+	bucket := newBucket("testMaceStats", "mem://", 1)
+	bucket.SetCapacity(2, EvictionLRU)
+	bucket.SetDataLoader(func(key string) *MaceItem {
+		if key == "loadable" {
+			return NewMaceItem(key, key, 0)
+		}
+		return nil
+	})
+
+	bucket.Cache("a", 0, "1")
+	bucket.Value("a")         // hit
+	bucket.Cache("b", 0, "2") // fits under capacity 2, nothing evicted yet
+	bucket.Value("missing")   // miss, loader returns nil -> load error
+	bucket.Value("loadable")  // miss, loader succeeds -> load, evicts LRU "a"
+
+	stats := bucket.Stats()
+	if stats.Hits != 1 {
+		t.Errorf("Expected 1 hit, got %d", stats.Hits)
+	}
+	if stats.EvictionsCapacity != 1 {
+		t.Errorf("Expected 1 capacity eviction, got %d", stats.EvictionsCapacity)
+	}
+	if stats.Loads != 2 {
+		t.Errorf("Expected 2 loader invocations, got %d", stats.Loads)
+	}
+	if stats.LoadErrors != 1 {
+		t.Errorf("Expected 1 load error, got %d", stats.LoadErrors)
+	}
+	if stats.Items != 2 {
+		t.Errorf("Expected 2 items across shards (b and loadable), got %d", stats.Items)
+	}
+	// Every loader call here is well under a second, so it should land in
+	// every finite bucket from 1s up, and the +Inf bucket (Loads) should
+	// account for both calls.
+	lastBucket := stats.LoadLatencyBuckets[numLoadLatencyBuckets-1]
+	if lastBucket != stats.Loads {
+		t.Errorf("Expected the top finite histogram bucket to see all %d loads, saw %d", stats.Loads, lastBucket)
+	}
+}
+
+func TestMaceStatsLoadLatencyHistogram(t *testing.T) {
+	bucket := newBucket("testMaceStatsLoadLatencyHistogram", "mem://", 1)
+	bucket.SetDataLoader(func(key string) *MaceItem {
+		time.Sleep(20 * time.Millisecond)
+		return NewMaceItem(key, key, 0)
+	})
+
+	bucket.Value("a")
+
+	stats := bucket.Stats()
+	for i, bound := range loadLatencyBounds {
+		want := int64(0)
+		if bound >= 50*time.Millisecond {
+			want = 1
+		}
+		if stats.LoadLatencyBuckets[i] != want {
+			t.Errorf("Bucket <=%s: expected %d, got %d", bound, want, stats.LoadLatencyBuckets[i])
+		}
+	}
+}
+
+func TestMaceShardedCount(t *testing.T) {
+	bucket := Mace("testMaceShardedCount", "mem://")
+	if len(bucket.shards) < 1 {
+		t.Fatal("Expected at least one shard")
+	}
+	for i := 0; i < 1000; i++ {
+		bucket.Cache(k+strconv.Itoa(i), 0, v)
+	}
+	if bucket.Count() != 1000 {
+		t.Error("Count() should fan out across all shards")
+	}
+	bucket.Flush()
+	if bucket.Count() != 0 {
+		t.Error("Flush() should clear every shard")
+	}
+}
+
+func TestMaceNonMemStoreSingleShard(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mace-shard-filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket := Mace("testMaceRemoteStoreSingleShard", "file://"+dir)
+	if len(bucket.shards) != 1 {
+		t.Error("Expected a non-memory backend to use a single shard")
+	}
+}
+
+func TestMaceSaveLoadFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mace-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/snapshot.gob"
+
+	saved := newBucket("testMaceSaveLoadFileSave", "mem://", 1)
+	// A sweep far in the future keeps the leak timer from reaping
+	// "expired" before SaveFile, so it is LoadFile that has to skip it.
+	saved.SetScavenger(time.Hour, 0)
+	saved.Cache("perm", 0, "forever")
+	saved.Cache("ttl", time.Hour, "still-alive")
+	saved.Cache("expired", 10*time.Millisecond, "long-gone")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := saved.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newBucket("testMaceSaveLoadFileLoad", "mem://", 1)
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Count() != 2 {
+		t.Errorf("Expected 2 items to survive the round trip, got %d", loaded.Count())
+	}
+	if p, err := loaded.Value("perm"); err != nil || p.Data().(string) != "forever" {
+		t.Error("Expected non-expiring item to survive a save/load round trip")
+	}
+	if p, err := loaded.Value("ttl"); err != nil || p.Data().(string) != "still-alive" {
+		t.Error("Expected unexpired TTL item to survive a save/load round trip")
+	}
+	if _, err := loaded.Value("expired"); err == nil {
+		t.Error("Expected an already-expired item to be skipped on load")
+	}
+}
+
+func TestMaceLeakCheckDrainsAllExpired(t *testing.T) {
+	bucket := newBucket("testMaceLeakCheckDrainsAllExpired", "mem://", 1)
+	s := bucket.shards[0]
+	// A sweep far in the future stops Cache from arming leak timers, so
+	// only the explicit leakCheck below can reclaim the items.
+	bucket.SetScavenger(time.Hour, 0)
+
+	for i := 0; i < 5; i++ {
+		bucket.Cache(k+strconv.Itoa(i), 50*time.Millisecond, v)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	bucket.leakCheck(s)
+
+	if bucket.Count() != 0 {
+		t.Errorf("Expected a single leakCheck pass to drain every expired item, %d left", bucket.Count())
+	}
+}
+
+func TestMaceScavenger(t *testing.T) {
+	bucket := newBucket("testMaceScavenger", "mem://", 1)
+	bucket.SetScavenger(50*time.Millisecond, 10*time.Millisecond)
+
+	bucket.Cache(k, 30*time.Millisecond, v)
+	time.Sleep(250 * time.Millisecond)
+
+	if bucket.Count() != 0 {
+		t.Error("Expected the scavenger sweep to reclaim the expired item")
+	}
+}
+
+func BenchmarkCacheGetConcurrentMem(b *testing.B) {
+	bucket := Mace("benchCacheGetConcurrentMem", "mem://")
+	bucket.Cache(k, 0, v)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bucket.Value(k)
+		}
+	})
+}
+
+func BenchmarkCacheGetConcurrentDistinctKeys(b *testing.B) {
+	bucket := Mace("benchCacheGetConcurrentDistinctKeys", "mem://")
+	const keys = 256
+	for i := 0; i < keys; i++ {
+		bucket.Cache(k+strconv.Itoa(i), 0, v)
+	}
+	b.ResetTimer()
+	var i int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&i, 1)
+			bucket.Value(k + strconv.Itoa(int(n%keys)))
+		}
+	})
+}
+
 func TestHeapQueue(t *testing.T) {
 	keys := "K"
 	l := leakQueue{}
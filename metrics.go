@@ -0,0 +1,83 @@
+package mace
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// numLoadLatencyBuckets is the number of finite buckets in the load
+// latency histogram; loadLatencyBounds has exactly this many entries.
+const numLoadLatencyBuckets = 9
+
+// loadLatencyBounds are the upper bounds of the finite load-latency
+// histogram buckets, chosen to span a typical loader call from
+// sub-millisecond to several seconds. The final, implicit +Inf bucket is
+// Stats.Loads itself, since every observation falls under it.
+var loadLatencyBounds = [numLoadLatencyBuckets]time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Stats is a point-in-time snapshot of a bucket's cache behavior,
+// aggregated across all of its shards. Its event counters are maintained
+// with sync/atomic on the hot path, so reading them never contends with a
+// Cache/Value/Delete call in flight; Items and Bytes are read under each
+// shard's read lock, which does wait for a writer holding that shard.
+type Stats struct {
+	Hits, Misses      int64
+	Loads, LoadErrors int64
+	EvictionsExpired  int64
+	EvictionsCapacity int64
+	EvictionsManual   int64
+	Items             int64
+	Bytes             int64
+
+	// LoadLatencyBuckets holds, for each bound in loadLatencyBounds, the
+	// cumulative count of loader calls that took at most that long
+	// (Prometheus "le" semantics): LoadLatencyBuckets[i] counts calls
+	// <= loadLatencyBounds[i]. Loads itself is the final +Inf bucket.
+	LoadLatencyBuckets [numLoadLatencyBuckets]int64
+
+	loadNanos int64
+}
+
+// AvgLoadLatency is the mean time spent in the data loader across Loads
+// calls, or 0 if the loader has never run. For the full distribution,
+// including tail latency, use LoadLatencyBuckets instead.
+func (s Stats) AvgLoadLatency() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return time.Duration(s.loadNanos / s.Loads)
+}
+
+// Stats returns a snapshot of this bucket's counters.
+func (bucket *MaceBucket) Stats() Stats {
+	var s Stats
+	for _, sh := range bucket.shards {
+		s.Hits += atomic.LoadInt64(&sh.stats.hits)
+		s.Misses += atomic.LoadInt64(&sh.stats.misses)
+		s.Loads += atomic.LoadInt64(&sh.stats.loads)
+		s.LoadErrors += atomic.LoadInt64(&sh.stats.loadErrors)
+		s.EvictionsExpired += atomic.LoadInt64(&sh.stats.evictExpired)
+		s.EvictionsCapacity += atomic.LoadInt64(&sh.stats.evictCapacity)
+		s.EvictionsManual += atomic.LoadInt64(&sh.stats.evictManual)
+		s.loadNanos += atomic.LoadInt64(&sh.stats.loadNanos)
+		for i := range s.LoadLatencyBuckets {
+			s.LoadLatencyBuckets[i] += atomic.LoadInt64(&sh.stats.loadLatencyCounts[i])
+		}
+
+		sh.RLock()
+		s.Items += int64(sh.store.Len())
+		s.Bytes += sh.totalBytes
+		sh.RUnlock()
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+//go:build mace_prometheus
+
+package mace
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// RegisterPrometheus publishes this bucket's Stats() snapshot to reg as
+// mace_cache_hits_total, mace_cache_misses_total, mace_cache_items,
+// mace_cache_bytes and mace_cache_evictions_total{reason=...}, plus
+// mace_cache_loads_total, mace_cache_load_errors_total and a histogram of
+// loader latency, mace_cache_load_duration_seconds. It's a pull-based prometheus.Collector
+// that only reads Stats() on scrape, so enabling it never adds work to
+// the hot path. Building with it requires the mace_prometheus build tag
+// and github.com/prometheus/client_golang as a dependency.
+//
+// labels are extra constant label name/value pairs applied to every
+// series alongside the bucket's own name, e.g.
+// RegisterPrometheus(reg, "service", "sessions").
+func (bucket *MaceBucket) RegisterPrometheus(reg prometheus.Registerer, labels ...string) error {
+	return reg.Register(newPromCollector(bucket, labels))
+}
+
+type promCollector struct {
+	bucket      *MaceBucket
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	loads       *prometheus.Desc
+	loadErrors  *prometheus.Desc
+	items       *prometheus.Desc
+	bytes       *prometheus.Desc
+	evictions   *prometheus.Desc
+	loadLatency *prometheus.Desc
+}
+
+func newPromCollector(bucket *MaceBucket, labels []string) *promCollector {
+	constLabels := prometheus.Labels{"bucket": bucket.name}
+	for i := 0; i+1 < len(labels); i += 2 {
+		constLabels[labels[i]] = labels[i+1]
+	}
+	return &promCollector{
+		bucket:      bucket,
+		hits:        prometheus.NewDesc("mace_cache_hits_total", "Cache hits.", nil, constLabels),
+		misses:      prometheus.NewDesc("mace_cache_misses_total", "Cache misses.", nil, constLabels),
+		loads:       prometheus.NewDesc("mace_cache_loads_total", "Data loader invocations.", nil, constLabels),
+		loadErrors:  prometheus.NewDesc("mace_cache_load_errors_total", "Data loader invocations that returned nil.", nil, constLabels),
+		items:       prometheus.NewDesc("mace_cache_items", "Current item count.", nil, constLabels),
+		bytes:       prometheus.NewDesc("mace_cache_bytes", "Current estimated byte size.", nil, constLabels),
+		evictions:   prometheus.NewDesc("mace_cache_evictions_total", "Evictions.", []string{"reason"}, constLabels),
+		loadLatency: prometheus.NewDesc("mace_cache_load_duration_seconds", "Histogram of data loader call latency.", nil, constLabels),
+	}
+}
+
+func (c *promCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.loads
+	ch <- c.loadErrors
+	ch <- c.items
+	ch <- c.bytes
+	ch <- c.evictions
+	ch <- c.loadLatency
+}
+
+func (c *promCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.bucket.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.loads, prometheus.CounterValue, float64(stats.Loads))
+	ch <- prometheus.MustNewConstMetric(c.loadErrors, prometheus.CounterValue, float64(stats.LoadErrors))
+	ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(stats.Items))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.EvictionsExpired), "expired")
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.EvictionsCapacity), "capacity")
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.EvictionsManual), "manual")
+
+	buckets := make(map[float64]uint64, len(loadLatencyBounds))
+	for i, bound := range loadLatencyBounds {
+		buckets[bound.Seconds()] = uint64(stats.LoadLatencyBuckets[i])
+	}
+	ch <- prometheus.MustNewConstHistogram(c.loadLatency, uint64(stats.Loads), float64(stats.loadNanos)/1e9, buckets)
+}
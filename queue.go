@@ -0,0 +1,68 @@
+package mace
+
+import (
+	"container/heap"
+	"time"
+)
+
+// disposeItem is one entry in a shard's leak queue: the key due to
+// expire and when. It doubles as the heap.Interface element, so index
+// tracks its current position for update/removal.
+type disposeItem struct {
+	disposeTime time.Time
+	value       string
+	index       int
+}
+
+// leakQueue is a min-heap of disposeItems ordered by disposeTime, so the
+// earliest expiry is always at the root. It implements heap.Interface.
+type leakQueue []*disposeItem
+
+func (l leakQueue) Len() int { return len(l) }
+
+func (l leakQueue) Less(i, j int) bool { return l[i].disposeTime.Before(l[j].disposeTime) }
+
+func (l leakQueue) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+	l[i].index = i
+	l[j].index = j
+}
+
+func (l *leakQueue) Push(x interface{}) {
+	item := x.(*disposeItem)
+	item.index = len(*l)
+	*l = append(*l, item)
+}
+
+func (l *leakQueue) Pop() interface{} {
+	old := *l
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*l = old[:n-1]
+	return item
+}
+
+// update re-establishes the heap invariant for item after its
+// disposeTime has changed in place (see shard.refreshDispose).
+func (l *leakQueue) update(item *disposeItem) {
+	if item.index < 0 || item.index >= l.Len() {
+		return
+	}
+	heap.Fix(l, item.index)
+}
+
+// refreshDispose recomputes item's place in the leak queue from its
+// current Created()/Alive() and re-heapifies. item.dispose.disposeTime
+// is only ever read (leakCheck) or written (here) while holding s.Lock,
+// which is what keeps it race-free against KeepAlive running
+// concurrently with no lock held at all. Callers must hold s.Lock() and
+// have already called item.KeepAlive().
+func (s *shard) refreshDispose(item *MaceItem) {
+	if item.dispose == nil {
+		return
+	}
+	item.dispose.disposeTime = item.Created().Add(item.Alive())
+	s.leakqueue.update(item.dispose)
+}
@@ -0,0 +1,188 @@
+package mace
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// RedisClient is the minimal surface mace needs from a Redis client. It
+// keeps the core package free of a hard dependency on any particular
+// driver (go-redis, redigo, ...) — wrap yours to satisfy this interface
+// and register it:
+//
+//	mace.RegisterStoreFactory("redis", func(dsn string) (mace.Store, error) {
+//		return mace.NewRedisStore(myRedisClient, ""), nil
+//	})
+type RedisClient interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Del(key string) error
+	Keys(pattern string) ([]string, error)
+}
+
+// MemcacheClient is the minimal surface mace needs from a Memcached
+// client; see RedisClient for the rationale.
+type MemcacheClient interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// remoteRecord is the wire format used by both remote stores: just
+// enough to reconstruct a *MaceItem via NewMaceItem on Get.
+type remoteRecord struct {
+	Data    interface{}
+	Created time.Time
+	Alive   time.Duration
+}
+
+func encodeRemoteRecord(item *MaceItem) ([]byte, error) {
+	var buf bytes.Buffer
+	rec := remoteRecord{Data: item.Data(), Created: item.Created(), Alive: item.Alive()}
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRemoteRecord(key string, raw []byte) (*MaceItem, error) {
+	var rec remoteRecord
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&rec); err != nil {
+		return nil, err
+	}
+	if rec.Alive == 0 {
+		return NewMaceItem(key, rec.Data, 0), nil
+	}
+	remaining := rec.Alive - time.Since(rec.Created)
+	return NewMaceItem(key, rec.Data, remaining), nil
+}
+
+// redisStore delegates both storage and TTL to Redis: Set writes with
+// the item's remaining alive duration as the key's expiry, so Redis
+// itself evicts expired items and the bucket's own leak queue never
+// needs to see them.
+type redisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore wraps client as a Store. prefix, if non-empty, is
+// prepended to every key to namespace a shared Redis instance.
+func NewRedisStore(client RedisClient, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) key(key string) string { return s.prefix + key }
+
+func (s *redisStore) Get(key string) (*MaceItem, bool) {
+	raw, err := s.client.Get(s.key(key))
+	if err != nil || raw == nil {
+		return nil, false
+	}
+	item, err := decodeRemoteRecord(key, raw)
+	if err != nil {
+		return nil, false
+	}
+	return item, true
+}
+
+func (s *redisStore) Set(key string, item *MaceItem) {
+	raw, err := encodeRemoteRecord(item)
+	if err != nil {
+		return
+	}
+	s.client.Set(s.key(key), raw, item.Alive())
+}
+
+func (s *redisStore) Delete(key string) {
+	s.client.Del(s.key(key))
+}
+
+func (s *redisStore) Iter() []*MaceItem {
+	keys, err := s.client.Keys(s.prefix + "*")
+	if err != nil {
+		return nil
+	}
+	out := make([]*MaceItem, 0, len(keys))
+	for _, k := range keys {
+		if item, ok := s.Get(k[len(s.prefix):]); ok {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (s *redisStore) Len() int {
+	return len(s.Iter())
+}
+
+func (s *redisStore) Flush() {
+	for _, item := range s.Iter() {
+		s.Delete(item.Key())
+	}
+}
+
+// memcacheStore mirrors redisStore for a Memcached client. Memcached has
+// no key-listing command, so Iter/Len/Flush only see keys mace has
+// touched since process start.
+type memcacheStore struct {
+	client MemcacheClient
+	prefix string
+	seen   map[string]bool
+}
+
+// NewMemcacheStore wraps client as a Store. prefix, if non-empty, is
+// prepended to every key to namespace a shared Memcached instance.
+func NewMemcacheStore(client MemcacheClient, prefix string) Store {
+	return &memcacheStore{client: client, prefix: prefix, seen: make(map[string]bool)}
+}
+
+func (s *memcacheStore) key(key string) string { return s.prefix + key }
+
+func (s *memcacheStore) Get(key string) (*MaceItem, bool) {
+	raw, err := s.client.Get(s.key(key))
+	if err != nil || raw == nil {
+		return nil, false
+	}
+	item, err := decodeRemoteRecord(key, raw)
+	if err != nil {
+		return nil, false
+	}
+	return item, true
+}
+
+func (s *memcacheStore) Set(key string, item *MaceItem) {
+	raw, err := encodeRemoteRecord(item)
+	if err != nil {
+		return
+	}
+	if err := s.client.Set(s.key(key), raw, item.Alive()); err == nil {
+		s.seen[key] = true
+	}
+}
+
+func (s *memcacheStore) Delete(key string) {
+	s.client.Delete(s.key(key))
+	delete(s.seen, key)
+}
+
+func (s *memcacheStore) Iter() []*MaceItem {
+	out := make([]*MaceItem, 0, len(s.seen))
+	for key := range s.seen {
+		if item, ok := s.Get(key); ok {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (s *memcacheStore) Len() int {
+	return len(s.Iter())
+}
+
+func (s *memcacheStore) Flush() {
+	for key := range s.seen {
+		s.Delete(key)
+	}
+}
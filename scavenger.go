@@ -0,0 +1,56 @@
+package mace
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SetScavenger switches a bucket from the default of reprogramming a
+// per-shard timer on every insert whose TTL is sooner than the current
+// next expiry, to a periodic sweep every interval plus up to jitter of
+// random slack (so many buckets started at the same time don't all sweep
+// in lockstep). This is cheaper for buckets taking a high insert rate,
+// where per-insert timer reprogramming itself becomes the bottleneck, at
+// the cost of letting expired items sit for up to interval+jitter before
+// they're reclaimed. Calling SetScavenger again replaces the previous
+// schedule; jitter <= 0 disables the random slack.
+func (bucket *MaceBucket) SetScavenger(interval, jitter time.Duration) {
+	bucket.cfgMu.Lock()
+	if bucket.scavengerStop != nil {
+		close(bucket.scavengerStop)
+	}
+	stop := make(chan struct{})
+	bucket.scavengerStop = stop
+	bucket.cfgMu.Unlock()
+
+	for _, s := range bucket.shards {
+		s.Lock()
+		s.scavenging = true
+		if s.leakTimer != nil {
+			s.leakTimer.Stop()
+			s.leakTimer = nil
+		}
+		s.Unlock()
+	}
+
+	go bucket.scavenge(interval, jitter, stop)
+}
+
+// scavenge runs leakCheck across every shard every interval+jitter until
+// stop is closed.
+func (bucket *MaceBucket) scavenge(interval, jitter time.Duration, stop <-chan struct{}) {
+	for {
+		d := interval
+		if jitter > 0 {
+			d += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(d):
+		}
+		for _, s := range bucket.shards {
+			bucket.leakCheck(s)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package mace
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shard owns one slice of a bucket's keyspace: its own store, RWMutex and
+// leak queue, so two keys that land in different shards never contend on
+// the same lock. Eviction bookkeeping (chunk0-1) is per-shard too, so
+// SetCapacity bounds each shard independently rather than the bucket as
+// a whole.
+type shard struct {
+	sync.RWMutex
+	store        Store
+	leakqueue    *leakQueue
+	leakTimer    *time.Timer
+	leakInterval time.Duration
+
+	// scavenging is true once SetScavenger has taken over expiry for
+	// this shard, so leakCheck knows not to re-arm a per-insert timer.
+	scavenging bool
+
+	totalBytes int64
+	lruList    *list.List
+	protected  *list.List
+	lruElems   map[string]*list.Element
+	freq       *freqQueue
+
+	// loadGroup coalesces concurrent GetOrLoad/Value misses for the
+	// same key; negatives remembers keys the loader recently returned
+	// nil for, see getorload.go.
+	loadGroup loadGroup
+	negMu     sync.Mutex
+	negatives map[string]time.Time
+
+	// stats backs Stats() (see metrics.go); every field is only ever
+	// touched with sync/atomic so collecting it never contends with
+	// the hot path.
+	stats shardStats
+}
+
+// shardStats are the atomic counters backing Stats(). Grouped in their
+// own struct purely for readability; each field is independent and
+// updated with atomic.AddInt64.
+type shardStats struct {
+	hits, misses                             int64
+	loads, loadErrors                        int64
+	evictExpired, evictCapacity, evictManual int64
+	loadNanos                                int64
+	loadLatencyCounts                        [numLoadLatencyBuckets]int64
+}
+
+// countEviction bumps the counter matching reason.
+func (s *shard) countEviction(reason EvictionReason) {
+	switch reason {
+	case EvictionReasonExpired:
+		atomic.AddInt64(&s.stats.evictExpired, 1)
+	case EvictionReasonCapacity:
+		atomic.AddInt64(&s.stats.evictCapacity, 1)
+	case EvictionReasonManual:
+		atomic.AddInt64(&s.stats.evictManual, 1)
+	}
+}
+
+// recordLoadLatency bumps every histogram bucket whose bound is at least
+// d, matching Prometheus's cumulative "le" bucket semantics.
+func (s *shard) recordLoadLatency(d time.Duration) {
+	for i, bound := range loadLatencyBounds {
+		if d <= bound {
+			atomic.AddInt64(&s.stats.loadLatencyCounts[i], 1)
+		}
+	}
+}
+
+func newShard(dsn string) (*shard, error) {
+	store, err := openStore(dsn)
+	if err != nil {
+		return nil, err
+	}
+	l := leakQueue{}
+	heap.Init(&l)
+	return &shard{store: store, leakqueue: &l}, nil
+}
+
+// defaultShardCount is 2*NumCPU rounded up to a power of two, so
+// fnv1a(key)&mask distributes keys evenly with a cheap bitmask instead of
+// a modulo.
+func defaultShardCount() int {
+	return nextPow2(2 * runtime.NumCPU())
+}
+
+func nextPow2(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+func fnv1a(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// shardFor returns the shard owning key. numShards is always a power of
+// two, so the mask form of the hash is equivalent to a modulo.
+func (bucket *MaceBucket) shardFor(key string) *shard {
+	idx := fnv1a(key) & uint32(len(bucket.shards)-1)
+	return bucket.shards[idx]
+}
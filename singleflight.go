@@ -0,0 +1,45 @@
+package mace
+
+import "sync"
+
+// call represents a loadItems invocation in flight for a given key.
+type call struct {
+	wg   sync.WaitGroup
+	item *MaceItem
+	err  error
+}
+
+// loadGroup coalesces concurrent loader calls for the same key into one,
+// the same shape as golang.org/x/sync/singleflight's Group. It is kept
+// in-package so the core build doesn't depend on golang.org/x/sync.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn for key, or waits for and returns the result of an in-flight
+// call for the same key if one is already running.
+func (g *loadGroup) Do(key string, fn func() (*MaceItem, error)) (*MaceItem, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.item, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.item, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.item, c.err
+}
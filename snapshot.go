@@ -0,0 +1,102 @@
+package mace
+
+import (
+	"encoding/gob"
+	"io"
+	"os"
+	"time"
+)
+
+// Register makes a concrete type usable as item data in SaveFile/SaveTo,
+// the same way registering it with encoding/gob is required for any
+// interface{} payload gob doesn't already know how to encode. It's a
+// thin wrapper so callers don't need their own encoding/gob import just
+// to warm up a cache.
+func Register(value interface{}) {
+	gob.Register(value)
+}
+
+// snapshotRecord is the on-the-wire representation of one cached item:
+// just enough to reconstruct it via Cache, mirroring fileRecord in
+// filestore.go.
+type snapshotRecord struct {
+	Key     string
+	Data    interface{}
+	Created time.Time
+	Alive   time.Duration
+}
+
+// SaveFile writes a snapshot of every live item in the bucket to path,
+// for LoadFile to rehydrate later. See SaveTo.
+func (bucket *MaceBucket) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return bucket.SaveTo(f)
+}
+
+// SaveTo gob-encodes every live item across every shard to w, one record
+// per item, so a restarting process can rehydrate the cache via LoadFrom
+// instead of starting cold. Payload types stored as interface{} must be
+// registered up front with Register, same as any other gob value.
+func (bucket *MaceBucket) SaveTo(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	for _, s := range bucket.shards {
+		s.RLock()
+		items := s.store.Iter()
+		s.RUnlock()
+		for _, item := range items {
+			rec := snapshotRecord{
+				Key:     item.Key(),
+				Data:    item.Data(),
+				Created: item.Created(),
+				Alive:   item.Alive(),
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFile rehydrates the bucket from a snapshot previously written by
+// SaveFile.
+func (bucket *MaceBucket) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return bucket.LoadFrom(f)
+}
+
+// LoadFrom reads records written by SaveTo and re-inserts them via
+// Cache, with their TTL reduced by however long has already elapsed
+// since they were saved. An item whose TTL has already elapsed is
+// skipped rather than cached with a non-positive Alive (an Alive of
+// exactly 0 would be read as "never expires", see NewMaceItem).
+func (bucket *MaceBucket) LoadFrom(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	for {
+		var rec snapshotRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Alive == 0 {
+			bucket.Cache(rec.Key, 0, rec.Data)
+			continue
+		}
+		remaining := rec.Alive - time.Since(rec.Created)
+		if remaining <= 0 {
+			continue
+		}
+		bucket.Cache(rec.Key, remaining, rec.Data)
+	}
+}
@@ -0,0 +1,121 @@
+package mace
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Store is the persistence layer behind a MaceBucket. The owning shard
+// keeps owning key-level locking (its embedded sync.RWMutex), TTL
+// tracking and the leak queue for the in-memory store; a Store only has
+// to hold items and hand them back.
+type Store interface {
+	Get(key string) (*MaceItem, bool)
+	Set(key string, item *MaceItem)
+	Delete(key string)
+	Iter() []*MaceItem
+	Len() int
+	Flush()
+}
+
+// StoreFactory builds a Store from the full DSN, scheme included. Register one
+// with RegisterStoreFactory to make Mace(name, dsn) able to open it.
+type StoreFactory func(dsn string) (Store, error)
+
+var (
+	storeFactoriesMu sync.Mutex
+	storeFactories   = map[string]StoreFactory{}
+)
+
+// RegisterStoreFactory makes Mace(name, dsn) recognize the given DSN
+// scheme. mace ships a dependency-free "mem" and "file" store out of the
+// box; backends that need an external client (Redis, Memcached, ...)
+// are registered by the caller, typically in an init() that wraps the
+// driver of choice behind the RedisClient/MemcacheClient interfaces in
+// remotestore.go.
+func RegisterStoreFactory(scheme string, factory StoreFactory) {
+	storeFactoriesMu.Lock()
+	defer storeFactoriesMu.Unlock()
+	storeFactories[scheme] = factory
+}
+
+func init() {
+	RegisterStoreFactory("", func(dsn string) (Store, error) { return newMemStore(), nil })
+	RegisterStoreFactory("mem", func(dsn string) (Store, error) { return newMemStore(), nil })
+}
+
+// schemeOf extracts the scheme component of a store DSN, treating an
+// empty DSN the same as the "mem" scheme.
+func schemeOf(dsn string) string {
+	if dsn == "" {
+		return "mem"
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	if u.Scheme == "" {
+		return "mem"
+	}
+	return u.Scheme
+}
+
+// openStore parses dsn and hands off to the factory registered for its
+// scheme, defaulting to the in-memory store for an empty DSN.
+func openStore(dsn string) (Store, error) {
+	if dsn == "" {
+		return newMemStore(), nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("mace: invalid dsn %q: %v", dsn, err)
+	}
+	storeFactoriesMu.Lock()
+	factory, ok := storeFactories[u.Scheme]
+	storeFactoriesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("mace: no store registered for scheme %q", u.Scheme)
+	}
+	return factory(dsn)
+}
+
+// memStore is the default Store: a plain map. It relies entirely on the
+// owning shard's RWMutex for concurrency, same as the map mace always
+// kept inline before Store existed.
+type memStore struct {
+	items map[string]*MaceItem
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: make(map[string]*MaceItem)}
+}
+
+func (s *memStore) Get(key string) (*MaceItem, bool) {
+	v, ok := s.items[key]
+	return v, ok
+}
+
+func (s *memStore) Set(key string, item *MaceItem) {
+	s.items[key] = item
+}
+
+func (s *memStore) Delete(key string) {
+	delete(s.items, key)
+}
+
+func (s *memStore) Iter() []*MaceItem {
+	out := make([]*MaceItem, 0, len(s.items))
+	for _, v := range s.items {
+		out = append(out, v)
+	}
+	return out
+}
+
+func (s *memStore) Len() int {
+	return len(s.items)
+}
+
+func (s *memStore) Flush() {
+	s.items = make(map[string]*MaceItem)
+}